@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// EmbeddingsRequest — OpenAI-совместимый запрос на POST /v1/embeddings.
+// Input может быть как одной строкой, так и массивом строк.
+type EmbeddingsRequest struct {
+	Model          string          `json:"model"`
+	Input          json.RawMessage `json:"input"`
+	EncodingFormat string          `json:"encoding_format"`
+}
+
+// parseEmbeddingsInput приводит input к []string вне зависимости от того,
+// пришла ли одна строка или массив строк.
+func parseEmbeddingsInput(raw json.RawMessage) ([]string, error) {
+	var asSlice []string
+	if err := json.Unmarshal(raw, &asSlice); err == nil {
+		return asSlice, nil
+	}
+	var asString string
+	if err := json.Unmarshal(raw, &asString); err != nil {
+		return nil, fmt.Errorf("разбор input: %w", err)
+	}
+	return []string{asString}, nil
+}
+
+// embeddingsHandler строит обработчик POST /v1/embeddings и /api/v0/embeddings,
+// который резолвит провайдера так же, как chatHandler, и форвардит запрос на эмбеддинги.
+func embeddingsHandler(reg *registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EmbeddingsRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+			return
+		}
+
+		input, err := parseEmbeddingsInput(req.Input)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		provider, err := reg.resolve(req.Model)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		opts := openai.EmbeddingRequestStrings{
+			Input:          input,
+			Model:          openai.EmbeddingModel(stripProviderPrefix(req.Model)),
+			EncodingFormat: openai.EmbeddingEncodingFormat(req.EncodingFormat),
+		}
+
+		resp, err := provider.CreateEmbeddings(c.Request.Context(), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := make([]gin.H, 0, len(resp.Data))
+		for _, e := range resp.Data {
+			data = append(data, gin.H{
+				"object":    "embedding",
+				"embedding": e.Embedding,
+				"index":     e.Index,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"object": "list",
+			"data":   data,
+			"model":  req.Model,
+			"usage": gin.H{
+				"prompt_tokens": resp.Usage.PromptTokens,
+				"total_tokens":  resp.Usage.TotalTokens,
+			},
+		})
+	}
+}
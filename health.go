@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// healthCooldown — на сколько провайдер уходит в бан после ошибки, которая
+// выглядит как сбой самого провайдера (429/5xx/401), а не запроса клиента.
+const healthCooldown = 30 * time.Second
+
+// healthTracker держит по провайдеру время, до которого его следует пропускать
+// при выборе кандидата в chatHandler — аналог health tracker'а в Glide.
+type healthTracker struct {
+	mu          sync.Mutex
+	unavailable map[string]time.Time
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{unavailable: make(map[string]time.Time)}
+}
+
+// available сообщает, можно ли сейчас пробовать провайдера с данным префиксом.
+func (h *healthTracker) available(prefix string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	until, banned := h.unavailable[prefix]
+	if !banned {
+		return true
+	}
+	return time.Now().After(until)
+}
+
+// recordSuccess снимает бан с провайдера.
+func (h *healthTracker) recordSuccess(prefix string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.unavailable, prefix)
+}
+
+// recordFailure банит провайдера на healthCooldown, если ошибка похожа на сбой
+// самого апстрима (429, 5xx, 401/403, обрыв соединения), а не на ошибку запроса.
+func (h *healthTracker) recordFailure(prefix string, err error) {
+	if !isUpstreamFailure(err) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unavailable[prefix] = time.Now().Add(healthCooldown)
+}
+
+// isUpstreamFailure отличает сбои апстрима (стоит ретраить на другом провайдере)
+// от ошибок в самом запросе (невалидная модель и т.п., ретраить бессмысленно).
+func isUpstreamFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests ||
+			apiErr.HTTPStatusCode == http.StatusUnauthorized ||
+			apiErr.HTTPStatusCode == http.StatusForbidden ||
+			apiErr.HTTPStatusCode >= http.StatusInternalServerError
+	}
+	// Не структурированная ошибка API — таймаут, обрыв TCP и т.п. Считаем сбоем апстрима.
+	return true
+}
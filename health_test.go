@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestIsUpstreamFailure(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"rate limited", &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}, true},
+		{"unauthorized", &openai.APIError{HTTPStatusCode: http.StatusUnauthorized}, true},
+		{"forbidden", &openai.APIError{HTTPStatusCode: http.StatusForbidden}, true},
+		{"server error", &openai.APIError{HTTPStatusCode: http.StatusBadGateway}, true},
+		{"bad request", &openai.APIError{HTTPStatusCode: http.StatusBadRequest}, false},
+		{"generic network error", errors.New("connection reset"), true},
+	}
+	for _, c := range cases {
+		if got := isUpstreamFailure(c.err); got != c.want {
+			t.Errorf("isUpstreamFailure(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHealthTrackerAvailableByDefault(t *testing.T) {
+	h := newHealthTracker()
+	if !h.available("openrouter") {
+		t.Error("available() for a never-seen prefix should be true")
+	}
+}
+
+func TestHealthTrackerRecordFailureBansOnlyUpstreamErrors(t *testing.T) {
+	h := newHealthTracker()
+
+	h.recordFailure("openai", &openai.APIError{HTTPStatusCode: http.StatusBadRequest})
+	if !h.available("openai") {
+		t.Error("a client-error (400) should not ban the provider")
+	}
+
+	h.recordFailure("openai", &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests})
+	if h.available("openai") {
+		t.Error("a 429 should ban the provider for the cooldown window")
+	}
+}
+
+func TestHealthTrackerRecordSuccessClearsBan(t *testing.T) {
+	h := newHealthTracker()
+	h.recordFailure("mistral", &openai.APIError{HTTPStatusCode: http.StatusInternalServerError})
+	if h.available("mistral") {
+		t.Fatal("provider should be banned after a 500")
+	}
+
+	h.recordSuccess("mistral")
+	if !h.available("mistral") {
+		t.Error("recordSuccess should clear the ban immediately")
+	}
+}
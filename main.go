@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,52 +16,116 @@ import (
 )
 
 type ChatRequest struct {
-	Model       string                         `json:"model"`
-	Messages    []openai.ChatCompletionMessage `json:"messages"`
-	Temperature float32                        `json:"temperature"`
-	TopP        float32                        `json:"top_p"`
-	MaxTokens   int                            `json:"max_tokens"`
-	Stream      bool                           `json:"stream"`
+	Model    string                         `json:"model"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+	// Temperature и TopP — указатели, чтобы отличить "клиент не задал поле"
+	// от "клиент явно попросил 0" (например, температуру 0 для жадного
+	// декодирования) — иначе applyModelConfig затёр бы явный 0 дефолтом из YAML.
+	Temperature *float32 `json:"temperature"`
+	TopP        *float32 `json:"top_p"`
+	MaxTokens   int      `json:"max_tokens"`
+	Stream      bool     `json:"stream"`
+
+	Tools      json.RawMessage `json:"tools"`
+	ToolChoice json.RawMessage `json:"tool_choice"`
+
+	// SessionID можно передать либо этим полем, либо заголовком X-Session-Id.
+	SessionID string `json:"session_id"`
 
 	// Дополнительные поля, которые просто проглатываем
 	KeepAlive json.RawMessage `json:"keep_alive"`
 	Format    json.RawMessage `json:"format"`
-	Tools     json.RawMessage `json:"tools"`
 	Options   json.RawMessage `json:"options"`
 }
 
+// parseTools разбирает OpenAI-совместимый массив "tools" из сырого JSON запроса.
+func parseTools(raw json.RawMessage) ([]openai.Tool, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var tools []openai.Tool
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return nil, fmt.Errorf("разбор tools: %w", err)
+	}
+	return tools, nil
+}
+
+// parseToolChoice разбирает "tool_choice", который в OpenAI API может быть
+// либо строкой ("auto"/"none"/"required"), либо объектом {"type":..., "function":...}.
+func parseToolChoice(raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var asString string
+	if err := json.Unmarshal(raw, &asString); err == nil {
+		return asString, nil
+	}
+	var asChoice openai.ToolChoice
+	if err := json.Unmarshal(raw, &asChoice); err != nil {
+		return nil, fmt.Errorf("разбор tool_choice: %w", err)
+	}
+	return asChoice, nil
+}
+
+// float32Value разворачивает указатель, используя 0 (т.е. "апстрим сам решит"),
+// если клиент поле не задавал.
+func float32Value(p *float32) float32 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// parseFallbackModels разбирает FALLBACK_MODELS="openai/gpt-4o-mini,mistral/mistral-small".
+func parseFallbackModels(env string) []string {
+	if env == "" {
+		return nil
+	}
+	var models []string
+	for _, m := range strings.Split(env, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
 func main() {
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPENROUTER_API_KEY не задан")
+	modelsPath := flag.String("models-path", "", "директория с YAML-конфигами моделей (name.yaml)")
+	flag.Parse()
+
+	reg := buildRegistry()
+
+	store, err := loadModelStore(*modelsPath)
+	if err != nil {
+		log.Fatalf("models-path: %v", err)
 	}
 
-	// Настраиваем клиента с нужным BaseURL
-	config := openai.DefaultConfig(apiKey)
-	config.BaseURL = "https://openrouter.ai/api/v1"
-	client := openai.NewClientWithConfig(config)
+	sessions := newSessionStore()
+	health := newHealthTracker()
+	fallbackModels := parseFallbackModels(os.Getenv("FALLBACK_MODELS"))
 
 	r := gin.Default()
 
-	// Обработчик для списка моделей
+	// Обработчик для списка моделей: YAML-конфиги из --models-path и автоматически
+	// обнаруженные модели провайдеров (включая эмбеддинги) — это не взаимоисключающие
+	// источники, так что объединяем оба списка, отдавая приоритет YAML-конфигу при
+	// совпадении id
 	modelsHandler := func(c *gin.Context) {
+		models := store.listModels()
+		seen := make(map[string]bool, len(models))
+		for _, m := range models {
+			seen[m.ID] = true
+		}
+		for _, m := range reg.listAllModels() {
+			if !seen[m.ID] {
+				models = append(models, m)
+				seen[m.ID] = true
+			}
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"object": "list",
-			"data": []gin.H{
-				{
-					"id":                    "deepseek/deepseek-chat-v3-0324:free",
-					"object":                "model",
-					"type":                  "llm",
-					"publisher":             "openrouter",
-					"arch":                  "llama",
-					"compatibility_type":    "openai",
-					"quantization":          "none",
-					"state":                 "loaded",
-					"max_context_length":    16384,
-					"loaded_context_length": 16384,
-					"created":               time.Now().Unix(),
-				},
-			},
+			"data":   models,
 		})
 	}
 
@@ -75,113 +141,159 @@ func main() {
 		}
 
 		log.Printf("[PROMPT] model=%s, messages=%d", req.Model, len(req.Messages))
-		// Если приходит название модели в старом формате — меняем
-		if req.Model == "deepseek-r1-distill-llama-8b" {
-			req.Model = "deepseek/deepseek-chat-v3-0324:free"
+
+		sessionID := c.GetHeader("X-Session-Id")
+		if sessionID == "" {
+			sessionID = req.SessionID
+		}
+		if sessionID != "" {
+			if !validSessionID(sessionID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+				return
+			}
+			if session, ok := sessions.Get(sessionID); ok {
+				req.Messages = mergeHistory(session.Messages, req.Messages)
+			}
+		}
+
+		// Если запрошенное имя — это алиас из --models-path, подставляем backend
+		// и применяем параметры/шаблон модели
+		if cfg, ok := store.resolve(req.Model); ok {
+			if err := applyModelConfig(&req, cfg); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 		}
 		if req.MaxTokens <= 0 {
 			req.MaxTokens = 1024
 		}
 
+		tools, err := parseTools(req.Tools)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		toolChoice, err := parseToolChoice(req.ToolChoice)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		opts := openai.ChatCompletionRequest{
-			Model:       req.Model,
 			Messages:    req.Messages,
-			Temperature: req.Temperature,
-			TopP:        req.TopP,
+			Temperature: float32Value(req.Temperature),
+			TopP:        float32Value(req.TopP),
 			MaxTokens:   req.MaxTokens,
 			Stream:      req.Stream,
+			Tools:       tools,
+			ToolChoice:  toolChoice,
 		}
 
 		// Контекст с увеличенным таймаутом
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
 
-		stream, err := client.CreateChatCompletionStream(ctx, opts)
-		if err != nil {
-			log.Printf("[ERROR] %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		defer stream.Close()
+		// Пробуем запрошенную модель, затем по очереди FALLBACK_MODELS. Заголовки
+		// ответа ещё не отправлены, так что неудачную попытку клиент не увидит —
+		// первый чанк мы читаем до того, как переключаем соединение в SSE-режим.
+		candidates := append([]string{req.Model}, fallbackModels...)
 
-		// Устанавливаем заголовки для SSE
-		c.Writer.Header().Set("Content-Type", "text/event-stream")
-		c.Writer.Header().Set("Cache-Control", "no-cache")
-		c.Writer.Header().Set("Connection", "keep-alive")
-		c.Writer.Header().Set("X-Accel-Buffering", "no")
-		c.Writer.WriteHeader(http.StatusOK)
-		c.Writer.Flush()
-
-		var lastChunk []byte = nil
+		var stream *sseChunkReader
+		var first *rawStreamChunk
+		var chosenModel string
+		var lastErr error
 
-		// Обрабатываем и отправляем чанки
-		for {
-			resp, err := stream.Recv()
+		for _, candidate := range candidates {
+			provider, err := reg.resolve(candidate)
 			if err != nil {
-				log.Printf("[STREAM END] err: %v", err)
-				// Если есть буферизированный последний чан, обрабатываем его
-				if lastChunk != nil {
-					var respMap map[string]interface{}
-					if err := json.Unmarshal(lastChunk, &respMap); err == nil {
-						if choices, ok := respMap["choices"].([]interface{}); ok && len(choices) > 0 {
-							if choiceMap, ok := choices[0].(map[string]interface{}); ok {
-								if delta, ok := choiceMap["delta"].(map[string]interface{}); ok {
-									// Если нет ключа "content", значит это финальный чан
-									if _, hasContent := delta["content"]; !hasContent {
-										choiceMap["delta"] = map[string]interface{}{}
-										choiceMap["finish_reason"] = "stop"
-									}
-								}
-							}
-						}
-						// Пересериализуем последний чан
-						lastChunk, _ = json.Marshal(respMap)
-					}
-					// Отправляем буферизированный последний чан
-					fmt.Fprintf(c.Writer, "data: %s\n\n", lastChunk)
-					c.Writer.Flush()
-				}
-				// Отправляем финальную строку [DONE]
-				fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
-				c.Writer.Flush()
-				break
+				lastErr = err
+				continue
 			}
 
-			// Если уже есть буферизированный чан, отправляем его
-			if lastChunk != nil {
-				fmt.Fprintf(c.Writer, "data: %s\n\n", lastChunk)
-				c.Writer.Flush()
+			// Ключуем cooldown по префиксу реально выбранного провайдера, а не по
+			// providerPrefix(candidate) — у голых имён моделей (без "provider/")
+			// он пустой, хотя резолвятся они на reg.fallback, и его тоже нужно
+			// пропускать, если он на cooldown.
+			prefix := provider.Prefix()
+			if !health.available(prefix) {
+				log.Printf("[FAILOVER] пропускаю %q: провайдер %q на cooldown", candidate, prefix)
+				continue
 			}
 
-			// Получаем JSON-байты ответа для текущего чанка
-			jsonBytes, err := json.Marshal(resp)
+			candidateOpts := opts
+			candidateOpts.Model = candidate
+
+			s, err := provider.CreateChatCompletionStream(ctx, candidateOpts)
 			if err != nil {
-				log.Printf("[JSON ERROR] %v", err)
+				log.Printf("[FAILOVER] %q: %v", candidate, err)
+				health.recordFailure(prefix, err)
+				// Ошибка самого запроса, а не апстрима (см. isUpstreamFailure) —
+				// на fallback-модели не переключаемся.
+				if !isUpstreamFailure(err) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				lastErr = err
 				continue
 			}
 
-			// Приводим формат к тому, что возвращает LM Studio, устанавливая logprobs в null
-			var respMap map[string]interface{}
-			if err := json.Unmarshal(jsonBytes, &respMap); err == nil {
-				if choices, ok := respMap["choices"].([]interface{}); ok {
-					for _, choice := range choices {
-						if choiceMap, ok := choice.(map[string]interface{}); ok {
-							choiceMap["logprobs"] = nil
-						}
-					}
-					jsonBytes, _ = json.Marshal(respMap)
-				} else {
-					log.Printf("[UNMARSHAL ERROR] %v", err)
-				}
+			firstChunk, err := s.next()
+			if err != nil {
+				log.Printf("[FAILOVER] %q: первый чанк: %v", candidate, err)
+				health.recordFailure(prefix, err)
+				lastErr = err
+				s.Close()
+				continue
 			}
 
-			// Буферизуем текущий чанк
-			lastChunk = jsonBytes
+			health.recordSuccess(prefix)
+			stream = s
+			first = firstChunk
+			chosenModel = candidate
+			break
+		}
+
+		if stream == nil {
+			log.Printf("[ERROR] все провайдеры недоступны: %v", lastErr)
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("все провайдеры недоступны: %v", lastErr)})
+			return
+		}
+		defer stream.Close()
+
+		// Устанавливаем заголовки для SSE
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Header().Set("X-Accel-Buffering", "no")
+		c.Writer.Header().Set("X-Upstream-Model", chosenModel)
+		c.Writer.WriteHeader(http.StatusOK)
+		c.Writer.Flush()
+
+		result := streamChatCompletion(c.Writer, chosenModel, stream, first)
+
+		if sessionID != "" {
+			// ToolCalls сохраняем вместе с Content: если эта реплика ассистента —
+			// чистый вызов инструмента (Content пустой), сессия всё равно должна
+			// запомнить, что ассистент попросил вызов, а не просто промолчал —
+			// иначе следующий ход модели теряет этот факт и ломает agentic-флоу.
+			messages := append(append([]openai.ChatCompletionMessage{}, req.Messages...), openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   result.content,
+				ToolCalls: result.toolCalls,
+			})
+			sessions.Save(&Session{ID: sessionID, Messages: messages, UpdatedAt: time.Now()})
 		}
 	}
 
 	r.POST("/v1/chat/completions", chatHandler)
 	r.POST("/api/v0/chat/completions", chatHandler)
 
+	r.POST("/v1/embeddings", embeddingsHandler(reg))
+	r.POST("/api/v0/embeddings", embeddingsHandler(reg))
+
+	r.GET("/v1/sessions", listSessionsHandler(sessions))
+	r.GET("/v1/sessions/:id", getSessionHandler(sessions))
+	r.DELETE("/v1/sessions/:id", deleteSessionHandler(sessions))
+
 	r.Run("127.0.0.1:1234")
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseToolsEmpty(t *testing.T) {
+	tools, err := parseTools(nil)
+	if err != nil || tools != nil {
+		t.Fatalf("parseTools(nil) = %v, %v; want nil, nil", tools, err)
+	}
+}
+
+func TestParseTools(t *testing.T) {
+	raw := json.RawMessage(`[{"type":"function","function":{"name":"get_weather","description":"d"}}]`)
+	tools, err := parseTools(raw)
+	if err != nil {
+		t.Fatalf("parseTools: %v", err)
+	}
+	if len(tools) != 1 || tools[0].Function.Name != "get_weather" {
+		t.Fatalf("parseTools = %+v, want one tool named get_weather", tools)
+	}
+}
+
+func TestParseToolsInvalid(t *testing.T) {
+	if _, err := parseTools(json.RawMessage(`"not an array"`)); err == nil {
+		t.Fatal("parseTools with malformed tools should error")
+	}
+}
+
+func TestParseToolChoiceString(t *testing.T) {
+	choice, err := parseToolChoice(json.RawMessage(`"auto"`))
+	if err != nil {
+		t.Fatalf("parseToolChoice: %v", err)
+	}
+	if choice != "auto" {
+		t.Fatalf("parseToolChoice(\"auto\") = %v, want \"auto\"", choice)
+	}
+}
+
+func TestParseToolChoiceObject(t *testing.T) {
+	raw := json.RawMessage(`{"type":"function","function":{"name":"get_weather"}}`)
+	choice, err := parseToolChoice(raw)
+	if err != nil {
+		t.Fatalf("parseToolChoice: %v", err)
+	}
+	if choice == nil {
+		t.Fatal("parseToolChoice(object) = nil, want a ToolChoice value")
+	}
+}
+
+func TestFloat32Value(t *testing.T) {
+	if got := float32Value(nil); got != 0 {
+		t.Errorf("float32Value(nil) = %v, want 0", got)
+	}
+	v := float32(0.5)
+	if got := float32Value(&v); got != 0.5 {
+		t.Errorf("float32Value(&0.5) = %v, want 0.5", got)
+	}
+}
+
+func TestParseFallbackModels(t *testing.T) {
+	got := parseFallbackModels(" openai/gpt-4o-mini ,mistral/mistral-small, ")
+	want := []string{"openai/gpt-4o-mini", "mistral/mistral-small"}
+	if len(got) != len(want) {
+		t.Fatalf("parseFallbackModels = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("parseFallbackModels = %v, want %v", got, want)
+		}
+	}
+	if parseFallbackModels("") != nil {
+		t.Error("parseFallbackModels(\"\") should be nil")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModelConfig — один YAML-файл из --models-path, описывающий модель,
+// которую мы показываем клиенту, и то, как она реально роутится к апстриму.
+type ModelConfig struct {
+	Name          string   `yaml:"name"`
+	Backend       string   `yaml:"backend"`
+	Aliases       []string `yaml:"aliases"`
+	ContextLength int      `yaml:"context_length"`
+
+	Temperature *float32 `yaml:"temperature"`
+	TopP        *float32 `yaml:"top_p"`
+	MaxTokens   int      `yaml:"max_tokens"`
+
+	// ChatTemplate — go-template, применяемый к содержимому каждого сообщения
+	// перед отправкой апстриму (например, чтобы обернуть его в формат модели).
+	ChatTemplate string `yaml:"chat_template"`
+}
+
+// templateData — то, что доступно внутри ChatTemplate.
+type templateData struct {
+	Role    string
+	Content string
+}
+
+// modelStore хранит загруженные конфиги и alias→config карту для быстрого резолва.
+type modelStore struct {
+	configs []*ModelConfig
+	byAlias map[string]*ModelConfig
+}
+
+func newModelStore() *modelStore {
+	return &modelStore{byAlias: make(map[string]*ModelConfig)}
+}
+
+// loadModelStore сканирует modelsPath на *.yaml/*.yml и строит alias→config карту.
+// Пустой modelsPath — не ошибка, просто конфигов не будет и резолв моделей
+// продолжит идти через реестр провайдеров как раньше.
+func loadModelStore(modelsPath string) (*modelStore, error) {
+	store := newModelStore()
+	if modelsPath == "" {
+		return store, nil
+	}
+
+	entries, err := os.ReadDir(modelsPath)
+	if err != nil {
+		return nil, fmt.Errorf("чтение --models-path %q: %w", modelsPath, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		path := filepath.Join(modelsPath, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("чтение %q: %w", path, err)
+		}
+
+		var cfg ModelConfig
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("разбор %q: %w", path, err)
+		}
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("%q: поле name обязательно", path)
+		}
+		if cfg.Backend == "" {
+			cfg.Backend = cfg.Name
+		}
+
+		store.configs = append(store.configs, &cfg)
+		store.byAlias[cfg.Name] = &cfg
+		for _, alias := range cfg.Aliases {
+			store.byAlias[alias] = &cfg
+		}
+		log.Printf("[MODELS] загружен %q -> backend=%s (aliases=%v)", cfg.Name, cfg.Backend, cfg.Aliases)
+	}
+
+	return store, nil
+}
+
+func (s *modelStore) resolve(name string) (*ModelConfig, bool) {
+	cfg, ok := s.byAlias[name]
+	return cfg, ok
+}
+
+// applyModelConfig переписывает req.Model на backend-имя, заполняет незаданные
+// параметры сэмплинга значениями из конфига и прогоняет сообщения через
+// ChatTemplate, если он задан.
+func applyModelConfig(req *ChatRequest, cfg *ModelConfig) error {
+	req.Model = cfg.Backend
+
+	if req.Temperature == nil && cfg.Temperature != nil {
+		req.Temperature = cfg.Temperature
+	}
+	if req.TopP == nil && cfg.TopP != nil {
+		req.TopP = cfg.TopP
+	}
+	if req.MaxTokens <= 0 && cfg.MaxTokens > 0 {
+		req.MaxTokens = cfg.MaxTokens
+	}
+
+	if cfg.ChatTemplate == "" {
+		return nil
+	}
+
+	tmpl, err := template.New(cfg.Name).Parse(cfg.ChatTemplate)
+	if err != nil {
+		return fmt.Errorf("разбор chat_template модели %q: %w", cfg.Name, err)
+	}
+
+	for i, msg := range req.Messages {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, templateData{Role: msg.Role, Content: msg.Content}); err != nil {
+			return fmt.Errorf("применение chat_template модели %q: %w", cfg.Name, err)
+		}
+		req.Messages[i].Content = buf.String()
+	}
+
+	return nil
+}
+
+func (s *modelStore) listModels() []Model {
+	models := make([]Model, 0, len(s.configs))
+	for _, cfg := range s.configs {
+		models = append(models, Model{
+			ID:                  cfg.Name,
+			Object:              "model",
+			Type:                "llm",
+			Publisher:           providerPrefix(cfg.Backend),
+			CompatibilityType:   "openai",
+			State:               "loaded",
+			MaxContextLength:    cfg.ContextLength,
+			LoadedContextLength: cfg.ContextLength,
+			Created:             time.Now().Unix(),
+		})
+	}
+	return models
+}
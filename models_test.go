@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func ptr32(f float32) *float32 { return &f }
+
+func TestApplyModelConfigDefaults(t *testing.T) {
+	cfg := &ModelConfig{
+		Name:        "my-model",
+		Backend:     "openai/gpt-4o-mini",
+		Temperature: ptr32(0.2),
+		TopP:        ptr32(0.9),
+		MaxTokens:   512,
+	}
+	req := &ChatRequest{Model: "my-model"}
+
+	if err := applyModelConfig(req, cfg); err != nil {
+		t.Fatalf("applyModelConfig: %v", err)
+	}
+
+	if req.Model != "openai/gpt-4o-mini" {
+		t.Errorf("Model = %q, want backend name", req.Model)
+	}
+	if req.Temperature == nil || *req.Temperature != 0.2 {
+		t.Errorf("Temperature = %v, want 0.2 from config", req.Temperature)
+	}
+	if req.TopP == nil || *req.TopP != 0.9 {
+		t.Errorf("TopP = %v, want 0.9 from config", req.TopP)
+	}
+	if req.MaxTokens != 512 {
+		t.Errorf("MaxTokens = %d, want 512", req.MaxTokens)
+	}
+}
+
+func TestApplyModelConfigDoesNotClobberExplicitValues(t *testing.T) {
+	cfg := &ModelConfig{
+		Name:        "my-model",
+		Backend:     "openai/gpt-4o-mini",
+		Temperature: ptr32(0.7),
+	}
+	// Клиент явно попросил температуру 0 (жадное декодирование) — applyModelConfig
+	// не должен подменить её дефолтом из конфига.
+	req := &ChatRequest{Model: "my-model", Temperature: ptr32(0)}
+
+	if err := applyModelConfig(req, cfg); err != nil {
+		t.Fatalf("applyModelConfig: %v", err)
+	}
+	if req.Temperature == nil || *req.Temperature != 0 {
+		t.Errorf("Temperature = %v, want explicit 0 preserved", req.Temperature)
+	}
+}
+
+func TestApplyModelConfigChatTemplate(t *testing.T) {
+	cfg := &ModelConfig{
+		Name:         "my-model",
+		Backend:      "ollama/llama3",
+		ChatTemplate: "[{{.Role}}] {{.Content}}",
+	}
+	req := &ChatRequest{
+		Model: "my-model",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "hello"},
+		},
+	}
+
+	if err := applyModelConfig(req, cfg); err != nil {
+		t.Fatalf("applyModelConfig: %v", err)
+	}
+	want := "[user] hello"
+	if got := req.Messages[0].Content; got != want {
+		t.Errorf("Messages[0].Content = %q, want %q", got, want)
+	}
+}
+
+func TestApplyModelConfigInvalidTemplate(t *testing.T) {
+	cfg := &ModelConfig{
+		Name:         "my-model",
+		Backend:      "ollama/llama3",
+		ChatTemplate: "{{.Role",
+	}
+	req := &ChatRequest{Model: "my-model"}
+
+	if err := applyModelConfig(req, cfg); err == nil {
+		t.Fatal("applyModelConfig with malformed template should error")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Model описывает одну модель в формате, понятном LM Studio / OpenAI-клиентам.
+type Model struct {
+	ID                  string `json:"id"`
+	Object              string `json:"object"`
+	Type                string `json:"type"`
+	Publisher           string `json:"publisher"`
+	Arch                string `json:"arch,omitempty"`
+	CompatibilityType   string `json:"compatibility_type"`
+	Quantization        string `json:"quantization,omitempty"`
+	State               string `json:"state"`
+	MaxContextLength    int    `json:"max_context_length,omitempty"`
+	LoadedContextLength int    `json:"loaded_context_length,omitempty"`
+	Created             int64  `json:"created"`
+}
+
+// Provider — апстрим, на который можно проксировать чат-запросы.
+// Каждый провайдер отвечает за свой кусок пространства имён моделей
+// (см. Prefix) и знает, как сходить в свой API.
+type Provider interface {
+	// Prefix — часть model-id до первого "/", по которой роутер выбирает провайдера.
+	// Например "openrouter", "mistral", "openai", "ollama".
+	Prefix() string
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (*sseChunkReader, error)
+	CreateEmbeddings(ctx context.Context, req openai.EmbeddingRequestStrings) (openai.EmbeddingResponse, error)
+	ListModels() []Model
+}
+
+// openAICompatProvider — провайдер поверх любого апстрима с OpenAI-совместимым
+// HTTP API (сам OpenAI, OpenRouter, Mistral, локальный Ollama и т.п.).
+type openAICompatProvider struct {
+	prefix         string
+	baseURL        string
+	apiKey         string
+	httpClient     *http.Client
+	client         *openai.Client
+	defaultModel   string
+	embeddingModel string
+}
+
+func newOpenAICompatProvider(prefix, baseURL, apiKey, defaultModel, embeddingModel string) *openAICompatProvider {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	} else {
+		baseURL = config.BaseURL
+	}
+	return &openAICompatProvider{
+		prefix:         prefix,
+		baseURL:        baseURL,
+		apiKey:         apiKey,
+		httpClient:     &http.Client{},
+		client:         openai.NewClientWithConfig(config),
+		defaultModel:   defaultModel,
+		embeddingModel: embeddingModel,
+	}
+}
+
+func (p *openAICompatProvider) Prefix() string {
+	return p.prefix
+}
+
+// CreateChatCompletionStream сам шлёт HTTP-запрос и отдаёт сырое тело ответа
+// в виде sseChunkReader, а не идёт через openai.Client.CreateChatCompletionStream:
+// тот декодирует каждый SSE-чанк в фиксированную структуру go-openai, в которой
+// нет ни ChatCompletionStreamResponse.Usage, ни ChatCompletionStreamChoiceDelta.
+// ReasoningContent — так что трейлинговый usage-чанк и reasoning_content-дельты
+// апстрима терялись ещё до того, как мы успевали их переслать клиенту.
+func (p *openAICompatProvider) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (*sseChunkReader, error) {
+	// Апстриму передаём модель без нашего префикса провайдера.
+	if providerPrefix(req.Model) == p.prefix {
+		req.Model = stripProviderPrefix(req.Model)
+	}
+	req.Stream = true
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("сериализация запроса: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.baseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		errBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return nil, &openai.APIError{
+			HTTPStatusCode: resp.StatusCode,
+			Message:        string(errBody),
+		}
+	}
+
+	return newSSEChunkReader(resp.Body), nil
+}
+
+func (p *openAICompatProvider) CreateEmbeddings(ctx context.Context, req openai.EmbeddingRequestStrings) (openai.EmbeddingResponse, error) {
+	req.Model = openai.EmbeddingModel(stripProviderPrefix(string(req.Model)))
+	return p.client.CreateEmbeddings(ctx, req)
+}
+
+func (p *openAICompatProvider) ListModels() []Model {
+	models := []Model{
+		{
+			ID:                p.prefix + "/" + p.defaultModel,
+			Object:            "model",
+			Type:              "llm",
+			Publisher:         p.prefix,
+			CompatibilityType: "openai",
+			State:             "loaded",
+			Created:           time.Now().Unix(),
+		},
+	}
+	if p.embeddingModel != "" {
+		models = append(models, Model{
+			ID:                p.prefix + "/" + p.embeddingModel,
+			Object:            "model",
+			Type:              "embeddings",
+			Publisher:         p.prefix,
+			CompatibilityType: "openai",
+			State:             "loaded",
+			Created:           time.Now().Unix(),
+		})
+	}
+	return models
+}
+
+// stripProviderPrefix убирает "openrouter/", "mistral/" и т.п. из начала model-id,
+// чтобы апстрим получил своё родное имя модели.
+func stripProviderPrefix(model string) string {
+	if idx := strings.Index(model, "/"); idx != -1 {
+		return model[idx+1:]
+	}
+	return model
+}
+
+// providerPrefix возвращает часть до первого "/", либо "" если префикса нет.
+func providerPrefix(model string) string {
+	if idx := strings.Index(model, "/"); idx != -1 {
+		return model[:idx]
+	}
+	return ""
+}
+
+// registry хранит зарегистрированных провайдеров и провайдера по умолчанию,
+// на который роутятся модели без распознанного префикса.
+type registry struct {
+	byPrefix map[string]Provider
+	ordered  []Provider
+	fallback Provider
+}
+
+func newRegistry() *registry {
+	return &registry{byPrefix: make(map[string]Provider)}
+}
+
+func (r *registry) register(p Provider) {
+	r.byPrefix[p.Prefix()] = p
+	r.ordered = append(r.ordered, p)
+}
+
+// resolve выбирает провайдера по префиксу model-id, либо возвращает fallback,
+// если префикс не распознан (обратная совместимость со старыми клиентами).
+func (r *registry) resolve(model string) (Provider, error) {
+	if p, ok := r.byPrefix[providerPrefix(model)]; ok {
+		return p, nil
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, fmt.Errorf("нет провайдера для модели %q", model)
+}
+
+func (r *registry) listAllModels() []Model {
+	var models []Model
+	for _, p := range r.ordered {
+		models = append(models, p.ListModels()...)
+	}
+	return models
+}
+
+// buildRegistry регистрирует провайдеров на основе переданных env-переменных
+// с API-ключами. OpenRouter всегда настраивается первым и служит провайдером
+// по умолчанию (DEFAULT_COMPLETER), как раньше, пока не переопределён явно.
+func buildRegistry() *registry {
+	reg := newRegistry()
+
+	type providerSpec struct {
+		prefix         string
+		baseURL        string
+		apiKeyEnv      string
+		defaultModel   string
+		embeddingModel string
+	}
+
+	// Anthropic нарочно не в этом списке: его API не OpenAI-совместим (другие
+	// эндпоинты, заголовки аутентификации и формат SSE), так что его нельзя
+	// завести через openAICompatProvider — нужен отдельный нативный провайдер
+	// за тем же интерфейсом Provider, пока не написанный.
+	specs := []providerSpec{
+		{"openrouter", "https://openrouter.ai/api/v1", "OPENROUTER_API_KEY", "deepseek/deepseek-chat-v3-0324:free", ""},
+		{"openai", "", "OPENAI_API_KEY", "gpt-4o-mini", "text-embedding-3-small"},
+		{"mistral", "https://api.mistral.ai/v1", "MISTRAL_API_KEY", "mistral-small-latest", "mistral-embed"},
+		{"ollama", "http://localhost:11434/v1", "OLLAMA_API_KEY", "llama3", "nomic-embed-text"},
+	}
+
+	for _, spec := range specs {
+		apiKey := os.Getenv(spec.apiKeyEnv)
+		if apiKey == "" && spec.prefix != "ollama" {
+			continue
+		}
+		reg.register(newOpenAICompatProvider(spec.prefix, spec.baseURL, apiKey, spec.defaultModel, spec.embeddingModel))
+		log.Printf("[PROVIDER] зарегистрирован %q (base=%s)", spec.prefix, spec.baseURL)
+	}
+
+	if len(reg.ordered) == 0 {
+		log.Fatal("не задано ни одного API-ключа провайдера (OPENROUTER_API_KEY, OPENAI_API_KEY, ...)")
+	}
+
+	defaultPrefix := os.Getenv("DEFAULT_COMPLETER")
+	if p, ok := reg.byPrefix[defaultPrefix]; ok {
+		reg.fallback = p
+	} else if p, ok := reg.byPrefix["openrouter"]; ok {
+		reg.fallback = p
+	} else {
+		reg.fallback = reg.ordered[0]
+	}
+
+	return reg
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestStripProviderPrefix(t *testing.T) {
+	cases := map[string]string{
+		"openrouter/deepseek/deepseek-chat-v3-0324:free": "deepseek/deepseek-chat-v3-0324:free",
+		"openai/gpt-4o-mini":                             "gpt-4o-mini",
+		"llama3":                                         "llama3",
+	}
+	for in, want := range cases {
+		if got := stripProviderPrefix(in); got != want {
+			t.Errorf("stripProviderPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestProviderPrefix(t *testing.T) {
+	cases := map[string]string{
+		"openai/gpt-4o-mini":           "openai",
+		"mistral/mistral-small-latest": "mistral",
+		"llama3":                       "",
+	}
+	for in, want := range cases {
+		if got := providerPrefix(in); got != want {
+			t.Errorf("providerPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	reg := newRegistry()
+	openrouter := &openAICompatProvider{prefix: "openrouter"}
+	mistral := &openAICompatProvider{prefix: "mistral"}
+	reg.register(openrouter)
+	reg.register(mistral)
+	reg.fallback = openrouter
+
+	p, err := reg.resolve("mistral/mistral-small-latest")
+	if err != nil || p != mistral {
+		t.Fatalf("resolve(mistral/...) = %v, %v; want mistral provider", p, err)
+	}
+
+	p, err = reg.resolve("llama3")
+	if err != nil || p != openrouter {
+		t.Fatalf("resolve(llama3) = %v, %v; want fallback provider", p, err)
+	}
+
+	reg.fallback = nil
+	if _, err := reg.resolve("unknown/model"); err == nil {
+		t.Fatal("resolve(unknown/model) with no fallback should error")
+	}
+}
+
+func TestRegistryListAllModels(t *testing.T) {
+	reg := newRegistry()
+	reg.register(newOpenAICompatProvider("openai", "", "key", "gpt-4o-mini", "text-embedding-3-small"))
+	models := reg.listAllModels()
+	if len(models) != 2 {
+		t.Fatalf("listAllModels() = %d models, want 2 (llm + embeddings)", len(models))
+	}
+}
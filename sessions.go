@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Session — накопленная история одного разговора, адресуемая X-Session-Id
+// (или JSON-полем session_id). Позволяет слать в следующий запрос только новую
+// реплику пользователя, пока прокси сам восстанавливает контекст.
+type Session struct {
+	ID        string                         `json:"id"`
+	Messages  []openai.ChatCompletionMessage `json:"messages"`
+	UpdatedAt time.Time                      `json:"updated_at"`
+}
+
+// SessionStore — хранилище сессий. in-memory по умолчанию, файловое — опционально
+// через SESSIONS_DIR.
+type SessionStore interface {
+	Get(id string) (*Session, bool)
+	Save(session *Session)
+	Delete(id string)
+	List() []*Session
+}
+
+// validSessionID проверяет, что id безопасно использовать как имя файла.
+// Id приходит от клиента (заголовок X-Session-Id, поле session_id или URL-параметр
+// :id), и без этой проверки fileSessionStore.path мог бы собрать путь вроде
+// "../../etc/cron.d/evil.json" через filepath.Join.
+func validSessionID(id string) bool {
+	if id == "" || strings.ContainsAny(id, "/\\") || strings.Contains(id, "..") {
+		return false
+	}
+	return id == filepath.Base(id)
+}
+
+// memorySessionStore хранит сессии в памяти процесса; данные теряются при рестарте.
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (s *memorySessionStore) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+func (s *memorySessionStore) Save(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+}
+
+func (s *memorySessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+func (s *memorySessionStore) List() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// fileSessionStore хранит каждую сессию JSON-файлом в SESSIONS_DIR — переживает рестарт.
+type fileSessionStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileSessionStore(dir string) (*fileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileSessionStore{dir: dir}, nil
+}
+
+func (s *fileSessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *fileSessionStore) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, false
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, false
+	}
+	return &session, true
+}
+
+func (s *fileSessionStore) Save(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(s.path(session.ID), data, 0o644)
+}
+
+func (s *fileSessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = os.Remove(s.path(id))
+}
+
+func (s *fileSessionStore) List() []*Session {
+	s.mu.Lock()
+	entries, err := os.ReadDir(s.dir)
+	s.mu.Unlock()
+	if err != nil {
+		return nil
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		id := entry.Name()[:len(entry.Name())-len(".json")]
+		if session, ok := s.Get(id); ok {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// newSessionStore выбирает файловое хранилище, если задан SESSIONS_DIR, иначе in-memory.
+func newSessionStore() SessionStore {
+	if dir := os.Getenv("SESSIONS_DIR"); dir != "" {
+		store, err := newFileSessionStore(dir)
+		if err != nil {
+			log.Printf("[SESSIONS] не удалось открыть SESSIONS_DIR=%q: %v, использую in-memory", dir, err)
+			return newMemorySessionStore()
+		}
+		return store
+	}
+	return newMemorySessionStore()
+}
+
+// mergeHistory объединяет сохранённую историю сессии с входящими сообщениями.
+// Если клиент прислал сообщения, уже начинающиеся с сохранённой истории
+// (вариант b — полная история), используем их как есть. Иначе (вариант a —
+// только новая реплика) подставляем сохранённую историю перед входящими.
+func mergeHistory(stored []openai.ChatCompletionMessage, incoming []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if len(stored) == 0 {
+		return incoming
+	}
+	if hasMessagePrefix(incoming, stored) {
+		return incoming
+	}
+
+	merged := make([]openai.ChatCompletionMessage, 0, len(stored)+len(incoming))
+	merged = append(merged, stored...)
+	merged = append(merged, incoming...)
+	return merged
+}
+
+func hasMessagePrefix(messages, prefix []openai.ChatCompletionMessage) bool {
+	if len(messages) < len(prefix) {
+		return false
+	}
+	for i, m := range prefix {
+		if messages[i].Role != m.Role || messages[i].Content != m.Content {
+			return false
+		}
+	}
+	return true
+}
+
+// listSessionsHandler — GET /v1/sessions, отдаёт список всех сессий без сообщений.
+func listSessionsHandler(sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		all := sessions.List()
+		data := make([]gin.H, 0, len(all))
+		for _, session := range all {
+			data = append(data, gin.H{
+				"id":            session.ID,
+				"message_count": len(session.Messages),
+				"updated_at":    session.UpdatedAt,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+	}
+}
+
+// getSessionHandler — GET /v1/sessions/:id, отдаёт сессию целиком для инспекции.
+func getSessionHandler(sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if !validSessionID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+			return
+		}
+		session, ok := sessions.Get(id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// deleteSessionHandler — DELETE /v1/sessions/:id, чистит сессию.
+func deleteSessionHandler(sessions SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if !validSessionID(id) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+			return
+		}
+		sessions.Delete(id)
+		c.JSON(http.StatusOK, gin.H{"deleted": id})
+	}
+}
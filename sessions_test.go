@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func msg(role, content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: role, Content: content}
+}
+
+func TestValidSessionID(t *testing.T) {
+	valid := []string{"abc123", "session-1", "a.b_c"}
+	for _, id := range valid {
+		if !validSessionID(id) {
+			t.Errorf("validSessionID(%q) = false, want true", id)
+		}
+	}
+
+	invalid := []string{"", "../etc/passwd", "a/b", "a\\b", "..", "foo/../bar"}
+	for _, id := range invalid {
+		if validSessionID(id) {
+			t.Errorf("validSessionID(%q) = true, want false", id)
+		}
+	}
+}
+
+func TestHasMessagePrefix(t *testing.T) {
+	stored := []openai.ChatCompletionMessage{msg("user", "hi"), msg("assistant", "hello")}
+
+	full := []openai.ChatCompletionMessage{msg("user", "hi"), msg("assistant", "hello"), msg("user", "how are you")}
+	if !hasMessagePrefix(full, stored) {
+		t.Error("hasMessagePrefix: full history including stored prefix should match")
+	}
+
+	onlyNew := []openai.ChatCompletionMessage{msg("user", "how are you")}
+	if hasMessagePrefix(onlyNew, stored) {
+		t.Error("hasMessagePrefix: new-turn-only messages should not match as a prefix")
+	}
+
+	diverged := []openai.ChatCompletionMessage{msg("user", "hi"), msg("assistant", "different")}
+	if hasMessagePrefix(diverged, stored) {
+		t.Error("hasMessagePrefix: diverging history should not match")
+	}
+}
+
+func TestMergeHistoryPrependsWhenClientSendsOnlyNewTurn(t *testing.T) {
+	stored := []openai.ChatCompletionMessage{msg("user", "hi"), msg("assistant", "hello")}
+	incoming := []openai.ChatCompletionMessage{msg("user", "how are you")}
+
+	merged := mergeHistory(stored, incoming)
+	if len(merged) != 3 {
+		t.Fatalf("mergeHistory = %d messages, want 3", len(merged))
+	}
+	if merged[2].Content != "how are you" {
+		t.Errorf("merged[2] = %+v, want the new turn appended last", merged[2])
+	}
+}
+
+func TestMergeHistoryKeepsFullHistoryAsIs(t *testing.T) {
+	stored := []openai.ChatCompletionMessage{msg("user", "hi")}
+	incoming := []openai.ChatCompletionMessage{msg("user", "hi"), msg("assistant", "hello")}
+
+	merged := mergeHistory(stored, incoming)
+	if len(merged) != 2 {
+		t.Fatalf("mergeHistory = %d messages, want 2 (incoming used as-is)", len(merged))
+	}
+}
+
+func TestMergeHistoryNoStoredSession(t *testing.T) {
+	incoming := []openai.ChatCompletionMessage{msg("user", "hi")}
+	if got := mergeHistory(nil, incoming); len(got) != 1 {
+		t.Fatalf("mergeHistory(nil, incoming) = %v, want incoming unchanged", got)
+	}
+}
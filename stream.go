@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// rawStreamChunk — чанк чат-стрима в сыром виде, как его прислал апстрим, без
+// просеивания через фиксированную схему openai.ChatCompletionStreamResponse.
+// Она не знает про reasoning_content в дельте и про usage в чанке без choices —
+// оба поля она бы молча выбросила при Unmarshal, а не просто оставила нулевыми.
+type rawStreamChunk struct {
+	ID      string            `json:"id"`
+	Object  string            `json:"object"`
+	Created int64             `json:"created"`
+	Model   string            `json:"model"`
+	Choices []rawStreamChoice `json:"choices"`
+	Usage   json.RawMessage   `json:"usage,omitempty"`
+}
+
+type rawStreamChoice struct {
+	Index        int             `json:"index"`
+	Delta        rawStreamDelta  `json:"delta"`
+	FinishReason *string         `json:"finish_reason"`
+	Logprobs     json.RawMessage `json:"logprobs"`
+}
+
+type rawStreamDelta struct {
+	Role             string        `json:"role,omitempty"`
+	Content          string        `json:"content,omitempty"`
+	ReasoningContent string        `json:"reasoning_content,omitempty"`
+	ToolCalls        []rawToolCall `json:"tool_calls,omitempty"`
+}
+
+type rawToolCall struct {
+	Index    int             `json:"index"`
+	ID       string          `json:"id,omitempty"`
+	Type     string          `json:"type,omitempty"`
+	Function rawToolCallFunc `json:"function,omitempty"`
+}
+
+type rawToolCallFunc struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// streamState отслеживает, видели ли мы уже finish_reason от апстрима, и какие
+// tool_calls собираются по ходу стрима (по индексу, как того требует протокол
+// инкрементальных tool_calls-дельт). Раньше прокси буферизовал "последний чанк"
+// и достраивал его задним числом — из-за этого reasoning- и tool_calls-чанки,
+// случайно оказавшиеся последними перед finish, портились. Теперь каждый чанк
+// пересылается сразу, а синтетический stop-чанк досылается, только если апстрим
+// оборвался, так и не прислав finish_reason.
+type streamState struct {
+	sawFinishReason bool
+	toolCalls       map[int]*toolCallAccumulator
+	content         strings.Builder
+}
+
+// toolCallAccumulator копит id/имя функции и её аргументы по инкрементальным
+// дельтам, чтобы в конце стрима отдать вызывающему коду законченный tool_call —
+// нужен для сохранения реплики ассистента в сессию (см. chatHandler): если этот
+// ход ассистента — чистый вызов инструмента, content пустой, и без tool_calls
+// сессия запомнила бы пустую реплику, как будто ассистент промолчал.
+type toolCallAccumulator struct {
+	id        string
+	name      string
+	arguments strings.Builder
+}
+
+func newStreamState() *streamState {
+	return &streamState{toolCalls: make(map[int]*toolCallAccumulator)}
+}
+
+// observe нормализует чанк (logprobs в null, как ожидает LM Studio) и обновляет
+// состояние стрима по его содержимому. Возвращает пересериализованный чанк с
+// полями, описанными в rawStreamChunk, включая reasoning_content и usage, которые
+// раньше терялись при проходе через openai.ChatCompletionStream. Поля апстрима,
+// которых в rawStreamChunk нет, при пересериализации отбрасываются.
+func (s *streamState) observe(chunk *rawStreamChunk) ([]byte, error) {
+	for i := range chunk.Choices {
+		choice := &chunk.Choices[i]
+		s.content.WriteString(choice.Delta.Content)
+		choice.Logprobs = nil
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.sawFinishReason = true
+		}
+		if len(choice.Delta.ToolCalls) > 0 {
+			s.accumulateToolCalls(choice.Delta.ToolCalls)
+		}
+	}
+
+	return json.Marshal(chunk)
+}
+
+func (s *streamState) accumulateToolCalls(toolCalls []rawToolCall) {
+	for _, tc := range toolCalls {
+		acc, ok := s.toolCalls[tc.Index]
+		if !ok {
+			acc = &toolCallAccumulator{}
+			s.toolCalls[tc.Index] = acc
+		}
+		if tc.ID != "" {
+			acc.id = tc.ID
+		}
+		if tc.Function.Name != "" {
+			acc.name = tc.Function.Name
+		}
+		if tc.Function.Arguments != "" {
+			acc.arguments.WriteString(tc.Function.Arguments)
+		}
+	}
+}
+
+// resultingToolCalls собирает накопленные по стриму tool_calls в порядке их
+// index — в таком виде их и нужно сохранять в истории сессии (см. chatHandler),
+// чтобы при следующем обращении к этой сессии модель помнила, что сама просила
+// вызов инструмента, а не просто промолчала.
+func (s *streamState) resultingToolCalls() []openai.ToolCall {
+	if len(s.toolCalls) == 0 {
+		return nil
+	}
+	maxIndex := 0
+	for index := range s.toolCalls {
+		if index > maxIndex {
+			maxIndex = index
+		}
+	}
+	calls := make([]openai.ToolCall, 0, len(s.toolCalls))
+	for index := 0; index <= maxIndex; index++ {
+		acc, ok := s.toolCalls[index]
+		if !ok {
+			continue
+		}
+		calls = append(calls, openai.ToolCall{
+			ID:   acc.id,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      acc.name,
+				Arguments: acc.arguments.String(),
+			},
+		})
+	}
+	return calls
+}
+
+// sseChunkReader читает SSE-тело ответа апстрима построчно и декодирует каждый
+// "data: ..." фрейм в rawStreamChunk, пропуская keep-alive-строки и останавливаясь
+// на "[DONE]".
+type sseChunkReader struct {
+	r    *bufio.Reader
+	body io.ReadCloser
+}
+
+func newSSEChunkReader(body io.ReadCloser) *sseChunkReader {
+	return &sseChunkReader{r: bufio.NewReader(body), body: body}
+}
+
+func (s *sseChunkReader) Close() error {
+	return s.body.Close()
+}
+
+// next возвращает следующий декодированный чанк. io.EOF сигналит, что апстрим
+// прислал "[DONE]" или оборвал соединение, не прислав его.
+func (s *sseChunkReader) next() (*rawStreamChunk, error) {
+	for {
+		line, err := s.r.ReadString('\n')
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed != "" {
+			if data, ok := strings.CutPrefix(trimmed, "data: "); ok {
+				if data == "[DONE]" {
+					return nil, io.EOF
+				}
+				var chunk rawStreamChunk
+				if jsonErr := json.Unmarshal([]byte(data), &chunk); jsonErr != nil {
+					log.Printf("[JSON ERROR] %v", jsonErr)
+				} else {
+					return &chunk, nil
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// writeSSEChunk пишет один SSE data-фрейм и сразу сбрасывает буфер — клиенты
+// ждут чанки по мере поступления, а не пачкой в конце.
+func writeSSEChunk(w http.ResponseWriter, payload []byte) {
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// streamResult — то, что streamChatCompletion накапливает по ходу стрима и
+// отдаёт вызывающему коду для сохранения в сессию.
+type streamResult struct {
+	content   string
+	toolCalls []openai.ToolCall
+}
+
+// streamChatCompletion читает стрим до конца, пересылая каждый чанк клиенту,
+// и досылает синтетический stop-чанк только если апстрим завершился, не прислав
+// свой собственный finish_reason (обрыв соединения, таймаут и т.п.). Возвращает
+// накопленные текст и tool_calls ответа ассистента — нужны вызывающему коду для
+// сохранения в сессию.
+//
+// first — уже прочитанный первый чанк, если вызывающий код прочитал его заранее,
+// чтобы проверить провайдера перед переключением ответа в режим стриминга
+// (см. chatHandler и health tracker); может быть nil.
+func streamChatCompletion(w http.ResponseWriter, model string, reader *sseChunkReader, first *rawStreamChunk) streamResult {
+	state := newStreamState()
+
+	if first != nil {
+		jsonBytes, err := state.observe(first)
+		if err != nil {
+			log.Printf("[JSON ERROR] %v", err)
+		} else {
+			writeSSEChunk(w, jsonBytes)
+		}
+	}
+
+	for {
+		chunk, err := reader.next()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[STREAM END] err: %v", err)
+			}
+			if !state.sawFinishReason {
+				writeSSEChunk(w, syntheticStopChunk(model))
+			}
+			for index, acc := range state.toolCalls {
+				log.Printf("[TOOL_CALL] index=%d id=%s name=%s", index, acc.id, acc.name)
+			}
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+			if f, ok := w.(interface{ Flush() }); ok {
+				f.Flush()
+			}
+			return streamResult{content: state.content.String(), toolCalls: state.resultingToolCalls()}
+		}
+
+		jsonBytes, err := state.observe(chunk)
+		if err != nil {
+			log.Printf("[JSON ERROR] %v", err)
+			continue
+		}
+		writeSSEChunk(w, jsonBytes)
+	}
+}
+
+// syntheticStopChunk — чанк, которым мы достраиваем стрим, если апстрим оборвался
+// без собственного finish_reason.
+func syntheticStopChunk(model string) []byte {
+	chunk := map[string]interface{}{
+		"id":     "synthetic-stop",
+		"object": "chat.completion.chunk",
+		"model":  model,
+		"choices": []map[string]interface{}{
+			{"index": 0, "delta": map[string]interface{}{}, "finish_reason": "stop", "logprobs": nil},
+		},
+	}
+	b, _ := json.Marshal(chunk)
+	return b
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decodeChunk(t *testing.T, raw string) *rawStreamChunk {
+	t.Helper()
+	var chunk rawStreamChunk
+	if err := json.Unmarshal([]byte(raw), &chunk); err != nil {
+		t.Fatalf("unmarshal %s: %v", raw, err)
+	}
+	return &chunk
+}
+
+// TestObserveForwardsReasoningContentAndUsage защищает от регрессии, из-за которой
+// стрим ходил через openai.ChatCompletionStreamResponse: там не было ни Usage,
+// ни ReasoningContent, и оба поля молча терялись при Unmarshal ещё до observe().
+func TestObserveForwardsReasoningContentAndUsage(t *testing.T) {
+	chunk := decodeChunk(t, `{"choices":[{"delta":{"reasoning_content":"thinking..."}}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`)
+
+	state := newStreamState()
+	out, err := state.observe(chunk)
+	if err != nil {
+		t.Fatalf("observe: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal observe() output: %v", err)
+	}
+
+	choices, _ := got["choices"].([]interface{})
+	if len(choices) != 1 {
+		t.Fatalf("choices = %v, want 1 entry", got["choices"])
+	}
+	delta, _ := choices[0].(map[string]interface{})["delta"].(map[string]interface{})
+	if delta["reasoning_content"] != "thinking..." {
+		t.Errorf("delta.reasoning_content = %v, want %q", delta["reasoning_content"], "thinking...")
+	}
+
+	usage, ok := got["usage"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("usage missing from observe() output entirely: %s", out)
+	}
+	if usage["total_tokens"] != float64(7) {
+		t.Errorf("usage.total_tokens = %v, want 7", usage["total_tokens"])
+	}
+}
+
+func TestObserveAccumulatesContentAndFinishReason(t *testing.T) {
+	state := newStreamState()
+
+	state.observe(decodeChunk(t, `{"choices":[{"delta":{"content":"Hel"}}]}`))
+	state.observe(decodeChunk(t, `{"choices":[{"delta":{"content":"lo"}}]}`))
+	if state.content.String() != "Hello" {
+		t.Errorf("content = %q, want %q", state.content.String(), "Hello")
+	}
+	if state.sawFinishReason {
+		t.Fatal("sawFinishReason = true before any finish_reason chunk")
+	}
+
+	state.observe(decodeChunk(t, `{"choices":[{"delta":{},"finish_reason":"stop"}]}`))
+	if !state.sawFinishReason {
+		t.Error("sawFinishReason = false after a chunk with finish_reason")
+	}
+}
+
+func TestObserveNullsLogprobs(t *testing.T) {
+	state := newStreamState()
+	out, err := state.observe(decodeChunk(t, `{"choices":[{"delta":{"content":"hi"},"logprobs":{"content":[]}}]}`))
+	if err != nil {
+		t.Fatalf("observe: %v", err)
+	}
+
+	var got map[string]interface{}
+	json.Unmarshal(out, &got)
+	choices := got["choices"].([]interface{})
+	choice := choices[0].(map[string]interface{})
+	if lp, ok := choice["logprobs"]; !ok || lp != nil {
+		t.Errorf("logprobs = %v, want explicit null", lp)
+	}
+}
+
+func TestObserveAccumulatesToolCallArguments(t *testing.T) {
+	state := newStreamState()
+	state.observe(decodeChunk(t, `{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"loc"}}]}}]}`))
+	state.observe(decodeChunk(t, `{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ation\":\"ru\"}"}}]}}]}`))
+
+	calls := state.resultingToolCalls()
+	if len(calls) != 1 {
+		t.Fatalf("resultingToolCalls() = %v, want 1 call", calls)
+	}
+	if calls[0].ID != "call_1" || calls[0].Function.Name != "get_weather" {
+		t.Fatalf("resultingToolCalls()[0] = %+v", calls[0])
+	}
+	want := `{"location":"ru"}`
+	if calls[0].Function.Arguments != want {
+		t.Errorf("Function.Arguments = %q, want %q", calls[0].Function.Arguments, want)
+	}
+}